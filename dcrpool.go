@@ -16,37 +16,60 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"time"
 
 	"decred.org/dcrwallet/rpc/walletrpc"
 	"github.com/decred/dcrd/rpcclient/v6"
 	"github.com/decred/dcrpool/gui"
+	"github.com/decred/dcrpool/gui/websocket"
 	"github.com/decred/dcrpool/pool"
+	"github.com/decred/dcrpool/pool/metrics"
+	"github.com/gofrs/flock"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
-// miningPool represents a decred Proof-of-Work mining pool.
+// dataDirLockFile is the advisory lock file created in the pool's home
+// directory to prevent two dcrpool instances from running against the same
+// BoltDB file or Postgres schema concurrently.
+const dataDirLockFile = "dcrpool.lock"
+
+// postgresDSN builds the connection string AcquirePGAdvisoryLock uses for
+// cfg's configured Postgres database, from the same host, port, user,
+// password and database name that are passed to InitPostgresDB, plus
+// cfg.PGSSLMode. InitPostgresDB builds its own connection string from its
+// arguments and does not use this one.
+func postgresDSN(cfg *config) string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.PGHost, cfg.PGPort, cfg.PGUser, cfg.PGPass, cfg.PGDBName, cfg.PGSSLMode)
+}
+
+// miningPool represents a decred Proof-of-Work mining pool. Its fields are
+// populated by the OnStart hooks registered in registerProviders as each
+// subsystem comes up.
 type miningPool struct {
-	cfg    *config
-	ctx    context.Context
-	cancel context.CancelFunc
-	hub    *pool.Hub
-	gui    *gui.GUI
+	cfg        *config
+	ctx        context.Context
+	cancel     context.CancelFunc
+	db         pool.Database
+	pgLock     *pool.PGAdvisoryLock
+	hub        *pool.Hub
+	gui        *gui.GUI
+	metrics    metrics.Metrics
+	wsNotifier *websocket.NotificationManager
 }
 
-// newPool initializes the mining pool.
-func newPool(db pool.Database, cfg *config) (*miningPool, error) {
-	p := new(miningPool)
-	p.cfg = cfg
-	dcrdRPCCfg := &rpcclient.ConnConfig{
-		Host:         cfg.DcrdRPCHost,
-		Endpoint:     "ws",
-		User:         cfg.RPCUser,
-		Pass:         cfg.RPCPass,
-		Certificates: cfg.dcrdRPCCerts,
-	}
-	p.ctx, p.cancel = context.WithCancel(context.Background())
+// registerProviders wires every dcrpool subsystem into a, in the order they
+// must start: Database, Metrics, WSNotifier, Hub, NodeConn, WalletConn and
+// GUI. Metrics and WSNotifier both precede Hub because they build the
+// Metrics/EventBus values HubConfig threads into the hub. Each subsystem is
+// registered as a hook with an OnStart and (where there is something to
+// release) an OnStop, so a.run can start them in order and unwind cleanly,
+// in reverse, on either a failed start or a shutdown.
+func registerProviders(a *app, p *miningPool, cfg *config) error {
 	powLimit := cfg.net.PowLimit
 	powLimitF, _ := new(big.Float).SetInt(powLimit).Float64()
 	iterations := math.Pow(2, 256-math.Floor(math.Log2(powLimitF)))
@@ -72,166 +95,339 @@ func newPool(db pool.Database, cfg *config) (*miningPool, error) {
 	_ = addPort(minerPorts, pool.CPU, cfg.CPUPort)
 	err := addPort(minerPorts, pool.InnosiliconD9, cfg.D9Port)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = addPort(minerPorts, pool.AntminerDR3, cfg.DR3Port)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = addPort(minerPorts, pool.AntminerDR5, cfg.DR5Port)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = addPort(minerPorts, pool.WhatsminerD1, cfg.D1Port)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = addPort(minerPorts, pool.ObeliskDCR1, cfg.DCR1Port)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	hcfg := &pool.HubConfig{
-		DB:                    db,
-		ActiveNet:             cfg.net.Params,
-		PoolFee:               cfg.PoolFee,
-		MaxGenTime:            cfg.MaxGenTime,
-		PaymentMethod:         cfg.PaymentMethod,
-		LastNPeriod:           cfg.LastNPeriod,
-		WalletPass:            cfg.WalletPass,
-		PoolFeeAddrs:          cfg.poolFeeAddrs,
-		SoloPool:              cfg.SoloPool,
-		NonceIterations:       iterations,
-		MinerPorts:            minerPorts,
-		MaxConnectionsPerHost: cfg.MaxConnectionsPerHost,
-		WalletAccount:         cfg.WalletAccount,
-		CoinbaseConfTimeout:   cfg.CoinbaseConfTimeout,
-	}
-	p.hub, err = pool.NewHub(p.cancel, hcfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize hub: %v", err)
+	// Build a connection config for every configured dcrd RPC endpoint.
+	// cfg.DcrdRPCHosts and cfg.dcrdRPCCertsList are parallel slices; the
+	// first entry is dialed first, with the rest held in reserve for
+	// failover.
+	dcrdRPCCfgs := make([]*rpcclient.ConnConfig, len(cfg.DcrdRPCHosts))
+	for i, host := range cfg.DcrdRPCHosts {
+		dcrdRPCCfgs[i] = &rpcclient.ConnConfig{
+			Host:         host,
+			Endpoint:     "ws",
+			User:         cfg.RPCUser,
+			Pass:         cfg.RPCPass,
+			Certificates: cfg.dcrdRPCCertsList[i],
+		}
 	}
 
-	// Establish a connection to the mining node.
-	ntfnHandlers := p.hub.CreateNotificationHandlers()
-	nodeConn, err := rpcclient.New(dcrdRPCCfg, ntfnHandlers)
-	if err != nil {
-		return nil, err
-	}
+	var nodeConnMgr *pool.NodeConnManager
+	var walletGRPCConn *grpc.ClientConn
+	var events *pool.EventBus
+	var accessTokens *pool.AccessTokenStore
 
-	if err := nodeConn.NotifyWork(p.ctx); err != nil {
-		nodeConn.Shutdown()
-		return nil, err
-	}
-	if err := nodeConn.NotifyBlocks(p.ctx); err != nil {
-		nodeConn.Shutdown()
-		return nil, err
-	}
+	a.register(&hook{
+		name: "Database",
+		onStart: func(ctx context.Context) error {
+			var err error
+			if cfg.UsePostgres {
+				p.db, err = pool.InitPostgresDB(cfg.PGHost, cfg.PGPort, cfg.PGUser,
+					cfg.PGPass, cfg.PGDBName)
+				if err != nil {
+					return err
+				}
 
-	p.hub.SetNodeConnection(nodeConn)
+				// Guard against a second dcrpool instance pointed at this
+				// same Postgres database from another host; the
+				// data-directory flock only protects a shared filesystem.
+				// The lock's connection string comes from postgresDSN, which
+				// uses the same host, port, user, password and database
+				// name passed to InitPostgresDB above, plus cfg.PGSSLMode.
+				p.pgLock, err = pool.AcquirePGAdvisoryLock(ctx, postgresDSN(cfg))
+				if err != nil {
+					p.db.Close()
+					return err
+				}
+				return nil
+			}
 
-	// Establish a connection to the wallet if the pool is mining as a
-	// publicly available mining pool.
-	if !cfg.SoloPool {
-		serverCAs := x509.NewCertPool()
-		serverCert, err := ioutil.ReadFile(cfg.WalletRPCCert)
-		if err != nil {
-			return nil, err
-		}
-		if !serverCAs.AppendCertsFromPEM(serverCert) {
-			return nil, fmt.Errorf("no certificates found in %s",
-				cfg.WalletRPCCert)
-		}
-		keypair, err := tls.LoadX509KeyPair(cfg.WalletTLSCert, cfg.WalletTLSKey)
-		if err != nil {
-			return nil, fmt.Errorf("unable to read keypair: %v", err)
-		}
-		creds := credentials.NewTLS(&tls.Config{
-			Certificates: []tls.Certificate{keypair},
-			RootCAs:      serverCAs,
-		})
-		grpc, err := grpc.Dial(cfg.WalletGRPCHost,
-			grpc.WithTransportCredentials(creds))
-		if err != nil {
-			return nil, err
-		}
+			p.db, err = pool.InitBoltDB(cfg.DBFile)
+			return err
+		},
+		onStop: func(ctx context.Context) error {
+			if !cfg.UsePostgres {
+				start := time.Now()
+				err := p.db.Backup(pool.BoltBackupFile)
+				if p.metrics != nil {
+					p.metrics.ObserveDBBackupDuration(time.Since(start).Seconds())
+				}
+				if err != nil {
+					mpLog.Errorf("failed to write database backup file: %v", err)
+				}
+			}
+			p.db.Close()
+			if p.pgLock != nil {
+				if err := p.pgLock.Release(ctx); err != nil {
+					mpLog.Errorf("failed to release postgres advisory lock: %v", err)
+				}
+			}
+			return nil
+		},
+	})
 
-		// Perform a Balance request to check connectivity and account
-		// existence.
-		walletConn := walletrpc.NewWalletServiceClient(grpc)
-		req := &walletrpc.BalanceRequest{
-			AccountNumber:         cfg.WalletAccount,
-			RequiredConfirmations: 1,
-		}
-		_, err = walletConn.Balance(p.ctx, req)
-		if err != nil {
-			return nil, err
-		}
+	a.register(&hook{
+		name: "Metrics",
+		onStart: func(ctx context.Context) error {
+			p.metrics = metrics.New()
+			if cfg.MetricsListen == "" {
+				return nil
+			}
+			// Start the Prometheus metrics server on its own listener so
+			// it can be firewalled off independently of the GUI.
+			go func() {
+				listenAddr := cfg.MetricsListen
+				mpLog.Infof("Creating metrics server listening on %s", listenAddr)
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metrics.Handler())
+				err := http.ListenAndServe(listenAddr, mux)
+				if err != nil {
+					mpLog.Criticalf(err.Error())
+					p.cancel()
+				}
+			}()
+			return nil
+		},
+	})
 
-		p.hub.SetWalletConnection(walletConn, grpc.Close)
+	a.register(&hook{
+		name: "WSNotifier",
+		onStart: func(ctx context.Context) error {
+			p.wsNotifier = websocket.NewNotificationManager()
+			events = pool.NewEventBus()
+			events.Subscribe(p.wsNotifier)
+			return nil
+		},
+	})
 
-		confNotifs, err := walletConn.ConfirmationNotifications(p.ctx)
-		if err != nil {
-			return nil, err
-		}
+	a.register(&hook{
+		name: "Hub",
+		onStart: func(ctx context.Context) error {
+			hcfg := &pool.HubConfig{
+				DB:                    p.db,
+				ActiveNet:             cfg.net.Params,
+				PoolFee:               cfg.PoolFee,
+				MaxGenTime:            cfg.MaxGenTime,
+				PaymentMethod:         cfg.PaymentMethod,
+				LastNPeriod:           cfg.LastNPeriod,
+				WalletPass:            cfg.WalletPass,
+				PoolFeeAddrs:          cfg.poolFeeAddrs,
+				SoloPool:              cfg.SoloPool,
+				NonceIterations:       iterations,
+				MinerPorts:            minerPorts,
+				MaxConnectionsPerHost: cfg.MaxConnectionsPerHost,
+				WalletAccount:         cfg.WalletAccount,
+				CoinbaseConfTimeout:   cfg.CoinbaseConfTimeout,
+				Metrics:               p.metrics,
+				EventBus:              events,
+			}
+			var err error
+			p.hub, err = pool.NewHub(p.cancel, hcfg)
+			if err != nil {
+				return fmt.Errorf("failed to initialize hub: %v", err)
+			}
+			return nil
+		},
+		onStop: func(ctx context.Context) error {
+			p.hub.CloseListeners()
+			return nil
+		},
+	})
 
-		p.hub.SetTxConfNotifClient(confNotifs)
-	}
+	a.register(&hook{
+		name: "NodeConn",
+		onStart: func(ctx context.Context) error {
+			ntfnHandlers := p.hub.CreateNotificationHandlers()
 
-	err = p.hub.FetchWork(p.ctx)
-	if err != nil {
-		return nil, err
-	}
-	err = p.hub.Listen()
-	if err != nil {
-		return nil, err
-	}
+			// NOTE: OnBlockConnected fires for every block connected to the
+			// main chain, not only ones this pool mined, so it is not a
+			// substitute for a real "pool found a block" signal. Recording
+			// EventBlockFound/RecordBlockFound here would mislabel ordinary
+			// network tip advances as pool wins. The real signal belongs on
+			// the share-submission path inside Hub, once one exists in this
+			// tree; until then this handler is left exactly as Hub provides
+			// it, rather than wired to a metric/event it can't honestly
+			// produce.
 
-	csrfSecret, err := p.hub.CSRFSecret()
-	if err != nil {
-		return nil, err
-	}
+			resubscribe := func(conn pool.RPCClient) error {
+				if err := conn.NotifyWork(p.ctx); err != nil {
+					return err
+				}
+				return conn.NotifyBlocks(p.ctx)
+			}
+			var err error
+			nodeConnMgr, err = pool.NewNodeConnManager(dcrdRPCCfgs, ntfnHandlers, resubscribe)
+			if err != nil {
+				return err
+			}
+			go nodeConnMgr.Run(p.ctx)
+			p.hub.SetNodeConnManager(nodeConnMgr)
+			return nil
+		},
+		onStop: func(ctx context.Context) error {
+			nodeConnMgr.Shutdown()
+			return nil
+		},
+	})
 
-	gcfg := &gui.Config{
-		SoloPool:              cfg.SoloPool,
-		GUIDir:                cfg.GUIDir,
-		AdminPass:             cfg.AdminPass,
-		GUIPort:               cfg.GUIPort,
-		UseLEHTTPS:            cfg.UseLEHTTPS,
-		Domain:                cfg.Domain,
-		TLSCertFile:           cfg.TLSCert,
-		TLSKeyFile:            cfg.TLSKey,
-		ActiveNet:             cfg.net.Params,
-		PaymentMethod:         cfg.PaymentMethod,
-		Designation:           cfg.Designation,
-		PoolFee:               cfg.PoolFee,
-		CSRFSecret:            csrfSecret,
-		MinerPorts:            minerPorts,
-		WithinLimit:           p.hub.WithinLimit,
-		FetchLastWorkHeight:   p.hub.FetchLastWorkHeight,
-		FetchLastPaymentInfo:  p.hub.FetchLastPaymentInfo,
-		FetchMinedWork:        p.hub.FetchMinedWork,
-		FetchWorkQuotas:       p.hub.FetchWorkQuotas,
-		FetchClients:          p.hub.FetchClients,
-		AccountExists:         p.hub.AccountExists,
-		FetchArchivedPayments: p.hub.FetchArchivedPayments,
-		FetchPendingPayments:  p.hub.FetchPendingPayments,
-		FetchCacheChannel:     p.hub.FetchCacheChannel,
-	}
+	if !cfg.SoloPool {
+		a.register(&hook{
+			name: "WalletConn",
+			onStart: func(ctx context.Context) error {
+				serverCAs := x509.NewCertPool()
+				serverCert, err := ioutil.ReadFile(cfg.WalletRPCCert)
+				if err != nil {
+					return err
+				}
+				if !serverCAs.AppendCertsFromPEM(serverCert) {
+					return fmt.Errorf("no certificates found in %s",
+						cfg.WalletRPCCert)
+				}
+				keypair, err := tls.LoadX509KeyPair(cfg.WalletTLSCert, cfg.WalletTLSKey)
+				if err != nil {
+					return fmt.Errorf("unable to read keypair: %v", err)
+				}
+				creds := credentials.NewTLS(&tls.Config{
+					Certificates: []tls.Certificate{keypair},
+					RootCAs:      serverCAs,
+				})
+				walletGRPCConn, err = grpc.Dial(cfg.WalletGRPCHost,
+					grpc.WithTransportCredentials(creds))
+				if err != nil {
+					return err
+				}
 
-	if !cfg.UsePostgres {
-		gcfg.HTTPBackupDB = p.hub.HTTPBackupDB
-	}
+				// Perform a Balance request to check connectivity and
+				// account existence.
+				walletConn := walletrpc.NewWalletServiceClient(walletGRPCConn)
+				req := &walletrpc.BalanceRequest{
+					AccountNumber:         cfg.WalletAccount,
+					RequiredConfirmations: 1,
+				}
+				_, err = walletConn.Balance(p.ctx, req)
+				if err != nil {
+					return err
+				}
 
-	p.gui, err = gui.NewGUI(gcfg)
-	if err != nil {
-		p.hub.CloseListeners()
-		return nil, err
+				p.hub.SetWalletConnection(walletConn, walletGRPCConn.Close)
+
+				confNotifs, err := walletConn.ConfirmationNotifications(p.ctx)
+				if err != nil {
+					return err
+				}
+				p.hub.SetTxConfNotifClient(confNotifs)
+				return nil
+			},
+			onStop: func(ctx context.Context) error {
+				return walletGRPCConn.Close()
+			},
+		})
 	}
-	return p, nil
+
+	a.register(&hook{
+		name: "GUI",
+		onStart: func(ctx context.Context) error {
+			err := p.hub.FetchWork(p.ctx)
+			if err != nil {
+				return err
+			}
+			err = p.hub.Listen()
+			if err != nil {
+				return err
+			}
+			go p.hub.Run(p.ctx)
+
+			csrfSecret, err := p.hub.CSRFSecret()
+			if err != nil {
+				return err
+			}
+
+			accessTokens = pool.NewAccessTokenStore(p.db)
+
+			wsHandler := gui.RequireAccessToken(accessTokens, pool.AccessTokenReadOnly,
+				p.wsNotifier.Handler)
+			tokensHandler := gui.RequireAccessToken(accessTokens, pool.AccessTokenAdmin,
+				gui.TokensHandler(accessTokens))
+
+			gcfg := &gui.Config{
+				SoloPool:              cfg.SoloPool,
+				GUIDir:                cfg.GUIDir,
+				AdminPass:             cfg.AdminPass,
+				GUIPort:               cfg.GUIPort,
+				UseLEHTTPS:            cfg.UseLEHTTPS,
+				Domain:                cfg.Domain,
+				TLSCertFile:           cfg.TLSCert,
+				TLSKeyFile:            cfg.TLSKey,
+				ActiveNet:             cfg.net.Params,
+				PaymentMethod:         cfg.PaymentMethod,
+				Designation:           cfg.Designation,
+				PoolFee:               cfg.PoolFee,
+				CSRFSecret:            csrfSecret,
+				MinerPorts:            minerPorts,
+				WithinLimit:           p.hub.WithinLimit,
+				FetchLastWorkHeight:   p.hub.FetchLastWorkHeight,
+				FetchLastPaymentInfo:  p.hub.FetchLastPaymentInfo,
+				FetchMinedWork:        p.hub.FetchMinedWork,
+				FetchWorkQuotas:       p.hub.FetchWorkQuotas,
+				FetchClients:          p.hub.FetchClients,
+				AccountExists:         p.hub.AccountExists,
+				FetchArchivedPayments: p.hub.FetchArchivedPayments,
+				FetchPendingPayments:  p.hub.FetchPendingPayments,
+				FetchCacheChannel:     p.hub.FetchCacheChannel,
+				Metrics:               p.metrics,
+				WSListen:              cfg.WSListen,
+				WSHandler:             wsHandler,
+				AccessTokens:          accessTokens,
+				TokensHandler:         tokensHandler,
+			}
+			if !cfg.UsePostgres {
+				// Wrap the DB backup download with AllowAccessToken: a
+				// request without a bearer token reaches p.hub.HTTPBackupDB
+				// unchanged, a request with an invalid or non-admin token is
+				// rejected, and one with a valid admin token is passed on to
+				// p.hub.HTTPBackupDB without skipping whatever
+				// authentication applies there.
+				gcfg.HTTPBackupDB = gui.AllowAccessToken(accessTokens, pool.AccessTokenAdmin,
+					p.hub.HTTPBackupDB)
+			}
+
+			p.gui, err = gui.NewGUI(gcfg)
+			if err != nil {
+				return err
+			}
+			p.gui.Run(p.ctx)
+			return nil
+		},
+		onStop: func(ctx context.Context) error {
+			return p.gui.Close(ctx)
+		},
+	})
+
+	return nil
 }
 
-func main() {
+// run is main's actual body, factored out so that every exit path runs its
+// deferred cleanup (in particular, releasing dataDirLock) before main calls
+// os.Exit with the returned code; os.Exit does not run deferred functions,
+// so it must never be called directly from inside run.
+func run() int {
 	// Listen for interrupt signals.
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
@@ -241,7 +437,7 @@ func main() {
 	cfg, _, err := loadConfig()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return 1
 	}
 	defer func() {
 		if logRotator != nil {
@@ -249,23 +445,30 @@ func main() {
 		}
 	}()
 
-	var db pool.Database
-	if cfg.UsePostgres {
-		db, err = pool.InitPostgresDB(cfg.PGHost, cfg.PGPort, cfg.PGUser,
-			cfg.PGPass, cfg.PGDBName)
-	} else {
-		db, err = pool.InitBoltDB(cfg.DBFile)
-	}
-
+	// Acquire an OS-level advisory lock on the data directory so a second,
+	// accidentally-launched dcrpool instance cannot corrupt pool state by
+	// operating on the same BoltDB file or Postgres schema concurrently.
+	dataDirLock := flock.New(filepath.Join(cfg.HomeDir, dataDirLockFile))
+	locked, err := dataDirLock.TryLock()
 	if err != nil {
-		mpLog.Errorf("failed to initialize database: %v", err)
-		os.Exit(1)
+		mpLog.Errorf("unable to acquire data directory lock: %v", err)
+		return 1
+	}
+	if !locked {
+		mpLog.Errorf("another dcrpool instance appears to be running " +
+			"against this data directory")
+		return 1
 	}
+	defer dataDirLock.Unlock()
 
-	p, err := newPool(db, cfg)
-	if err != nil {
-		mpLog.Errorf("failed to initialize pool: %v", err)
-		os.Exit(1)
+	p := new(miningPool)
+	p.cfg = cfg
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	a := newApp()
+	if err := registerProviders(a, p, cfg); err != nil {
+		mpLog.Errorf("failed to wire dcrpool subsystems: %v", err)
+		return 1
 	}
 
 	if cfg.Profile != "" {
@@ -288,7 +491,6 @@ func main() {
 	mpLog.Infof("Version: %s", version())
 	mpLog.Infof("Runtime: Go version %s", runtime.Version())
 	mpLog.Infof("Home dir: %s", cfg.HomeDir)
-	mpLog.Infof("Started dcrpool.")
 
 	go func() {
 		select {
@@ -299,18 +501,15 @@ func main() {
 			p.cancel()
 		}
 	}()
-	p.gui.Run(p.ctx)
-	p.hub.Run(p.ctx)
-
-	// hub.Run() blocks until the pool is fully shut down. When it returns,
-	// write a backup of the DB (if not using postgres), and then close the DB.
-	if !cfg.UsePostgres {
-		mpLog.Tracef("Backing up database.")
-		err = db.Backup(pool.BoltBackupFile)
-		if err != nil {
-			mpLog.Errorf("failed to write database backup file: %v", err)
-		}
+
+	mpLog.Infof("Started dcrpool.")
+	if err := a.run(p.ctx); err != nil {
+		mpLog.Errorf("failed to start dcrpool: %v", err)
+		return 1
 	}
+	return 0
+}
 
-	db.Close()
+func main() {
+	os.Exit(run())
 }
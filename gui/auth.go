@@ -0,0 +1,150 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package gui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/decred/dcrpool/pool"
+)
+
+// bearerToken extracts the token from an `Authorization: Bearer <token>`
+// header, returning the empty string if the header is absent or malformed.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(header, prefix)
+}
+
+// RequireAccessToken wraps next with a hard requirement for a valid bearer
+// token of at least tokenType privilege, as determined by store. Use it for
+// routes with no other authentication of their own, such as the websocket
+// feed and the token CRUD endpoint: a request without a bearer token, or
+// with an invalid one, is always rejected.
+func RequireAccessToken(store *pool.AccessTokenStore, tokenType pool.AccessTokenType, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		if store == nil {
+			http.Error(w, "access tokens not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		ok, err := store.Check(token, tokenType)
+		if err != nil {
+			http.Error(w, "unable to validate access token", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "invalid or insufficient access token", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// AllowAccessToken wraps next with an optional bearer-token check that
+// keeps whatever authentication next already performs: a request with no
+// bearer token at all falls through to next unchanged, so a route already
+// reachable through the existing AdminPass cookie session (for example the
+// DB backup download) keeps working exactly as before this token store
+// existed. A request that presents a valid token of at least tokenType
+// privilege is also passed on to next, which still applies its own
+// authentication; the token does not by itself grant access that next
+// refuses. A request that presents an invalid or insufficient token is
+// rejected outright rather than falling through.
+func AllowAccessToken(store *pool.AccessTokenStore, tokenType pool.AccessTokenType, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			next(w, r)
+			return
+		}
+		if store == nil {
+			http.Error(w, "access tokens not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		ok, err := store.Check(token, tokenType)
+		if err != nil {
+			http.Error(w, "unable to validate access token", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "invalid or insufficient access token", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireAccessToken is the GUI-bound convenience form of RequireAccessToken
+// for routes registered on the admin mux, using the store configured on ui.
+func (ui *GUI) requireAccessToken(tokenType pool.AccessTokenType, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAccessToken(ui.cfg.AccessTokens, tokenType, next)
+}
+
+// createTokenRequest is the JSON body accepted by TokensHandler's POST case.
+type createTokenRequest struct {
+	Type pool.AccessTokenType `json:"type"`
+	Name string               `json:"name"`
+}
+
+// TokensHandler implements CRUD for access tokens over the admin mux:
+// GET lists tokens, POST creates one from a createTokenRequest body, and
+// DELETE removes the token named by the `name` query parameter. Callers
+// must wrap it with RequireAccessToken(store, pool.AccessTokenAdmin, ...)
+// before registering it.
+func TokensHandler(store *pool.AccessTokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			tokens, err := store.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(tokens)
+
+		case http.MethodPost:
+			var req createTokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			tok, err := store.Create(req.Type, req.Name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(tok)
+
+		case http.MethodDelete:
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				http.Error(w, "missing name parameter", http.StatusBadRequest)
+				return
+			}
+			if err := store.Delete(name); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package websocket implements a notification manager that pushes pool
+// activity to subscribed GUI clients instead of requiring them to poll.
+package websocket
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/decred/dcrpool/pool"
+)
+
+// Topic identifies a stream of events a client can subscribe to.
+type Topic string
+
+const (
+	// TopicBlocks carries newly mined block notifications.
+	TopicBlocks Topic = "blocks"
+
+	// TopicShares carries accepted share notifications.
+	TopicShares Topic = "shares"
+
+	// TopicClients carries client connect/disconnect notifications.
+	TopicClients Topic = "clients"
+
+	// TopicPayments carries paid payment notifications.
+	TopicPayments Topic = "payments"
+
+	// TopicHashrate carries periodic hashrate ticks.
+	TopicHashrate Topic = "hashrate"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// message is the JSON payload pushed to subscribed clients.
+type message struct {
+	Topic Topic       `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// client is a single subscribed websocket connection.
+type client struct {
+	conn   *websocket.Conn
+	send   chan message
+	topics map[Topic]bool
+}
+
+// NotificationManager maintains the set of subscribed GUI clients and
+// pushes JSON events to them as pool activity occurs. It is modeled after
+// the WSNotificationManager pattern used by other node GUIs: one manager,
+// many topic-scoped subscribers.
+type NotificationManager struct {
+	mtx     sync.RWMutex
+	clients map[*client]bool
+}
+
+// NewNotificationManager creates an empty NotificationManager.
+func NewNotificationManager() *NotificationManager {
+	return &NotificationManager{
+		clients: make(map[*client]bool),
+	}
+}
+
+// topicForEvent maps a pool event type to the websocket topic subscribers
+// opt into.
+func topicForEvent(evt pool.Event) (Topic, bool) {
+	switch evt.Type {
+	case pool.EventBlockFound:
+		return TopicBlocks, true
+	case pool.EventShareAccepted:
+		return TopicShares, true
+	case pool.EventClientConnected, pool.EventClientDisconnected:
+		return TopicClients, true
+	case pool.EventPaymentPaid:
+		return TopicPayments, true
+	case pool.EventHashrateTick:
+		return TopicHashrate, true
+	default:
+		return "", false
+	}
+}
+
+// Notify implements pool.Subscriber. It is registered with the hub's
+// EventBus and pushes the event to every client subscribed to its topic.
+func (mgr *NotificationManager) Notify(evt pool.Event) {
+	topic, ok := topicForEvent(evt)
+	if !ok {
+		return
+	}
+
+	msg := message{Topic: topic, Data: evt.Data}
+
+	mgr.mtx.RLock()
+	defer mgr.mtx.RUnlock()
+	for c := range mgr.clients {
+		if !c.topics[topic] {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			// Slow client, drop the message rather than blocking the
+			// publisher.
+		}
+	}
+}
+
+// Handler upgrades the connection to a websocket and registers it for the
+// topics requested via the `topics` query parameter (comma separated). The
+// caller is expected to have already authenticated the request (dcrpool
+// wraps Handler with gui.RequireAccessToken) before invoking Handler.
+func (mgr *NotificationManager) Handler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	topics := make(map[Topic]bool)
+	for _, v := range r.URL.Query()["topics"] {
+		for _, t := range strings.Split(v, ",") {
+			topics[Topic(t)] = true
+		}
+	}
+
+	c := &client{
+		conn:   conn,
+		send:   make(chan message, 32),
+		topics: topics,
+	}
+
+	mgr.mtx.Lock()
+	mgr.clients[c] = true
+	mgr.mtx.Unlock()
+
+	go mgr.writePump(c)
+	go mgr.readPump(c)
+}
+
+// readPump discards incoming messages but keeps the connection alive and
+// removes the client once it closes.
+func (mgr *NotificationManager) readPump(c *client) {
+	defer mgr.remove(c)
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump delivers queued messages to the client as JSON frames.
+func (mgr *NotificationManager) writePump(c *client) {
+	defer c.conn.Close()
+	for msg := range c.send {
+		if err := c.conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// remove unregisters a client and closes its send channel.
+func (mgr *NotificationManager) remove(c *client) {
+	mgr.mtx.Lock()
+	defer mgr.mtx.Unlock()
+	if mgr.clients[c] {
+		delete(mgr.clients, c)
+		close(c.send)
+	}
+}
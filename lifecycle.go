@@ -0,0 +1,101 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// stopTimeout bounds how long a single subsystem's OnStop hook is given to
+// shut down cleanly before the app moves on to the next one.
+const stopTimeout = 10 * time.Second
+
+// hook pairs a named subsystem with its start and stop behavior. OnStop may
+// be nil for subsystems that have nothing to release.
+type hook struct {
+	name    string
+	onStart func(ctx context.Context) error
+	onStop  func(ctx context.Context) error
+}
+
+// app is a small lifecycle container for dcrpool's subsystems: Database,
+// Metrics, WSNotifier, Hub, NodeConn, WalletConn and GUI are each registered
+// as a hook in dependency order (Metrics and WSNotifier precede Hub because
+// they build the Metrics/EventBus values HubConfig consumes). Start runs
+// hooks in registration order and,
+// on any error, rolls back the hooks already started in reverse. Stop runs
+// the started hooks' OnStop in reverse order, each bounded by stopTimeout,
+// so a slow subsystem cannot wedge shutdown indefinitely.
+type app struct {
+	hooks   []*hook
+	started []*hook
+}
+
+// newApp creates an empty lifecycle container.
+func newApp() *app {
+	return &app{}
+}
+
+// register adds a subsystem to the lifecycle graph. Hooks start in the
+// order they are registered and stop in the reverse order.
+func (a *app) register(h *hook) {
+	a.hooks = append(a.hooks, h)
+}
+
+// start runs every registered hook's OnStart in order, rolling back already
+// started hooks in reverse if one fails.
+func (a *app) start(ctx context.Context) error {
+	for _, h := range a.hooks {
+		if h.onStart != nil {
+			if err := h.onStart(ctx); err != nil {
+				a.stop(ctx)
+				return fmt.Errorf("%s: %v", h.name, err)
+			}
+		}
+		a.started = append(a.started, h)
+	}
+	return nil
+}
+
+// stop runs the OnStop hook of every started subsystem in reverse
+// registration order, each bounded by stopTimeout.
+func (a *app) stop(ctx context.Context) {
+	for i := len(a.started) - 1; i >= 0; i-- {
+		h := a.started[i]
+		if h.onStop == nil {
+			continue
+		}
+		stopCtx, cancel := context.WithTimeout(ctx, stopTimeout)
+		errc := make(chan error, 1)
+		go func() { errc <- h.onStop(stopCtx) }()
+		timer := time.NewTimer(stopTimeout)
+		select {
+		case err := <-errc:
+			if err != nil {
+				mpLog.Errorf("%s: error during shutdown: %v", h.name, err)
+			}
+		case <-timer.C:
+			mpLog.Errorf("%s: shutdown timed out after %v", h.name, stopTimeout)
+		}
+		timer.Stop()
+		cancel()
+	}
+	a.started = nil
+}
+
+// run starts all registered subsystems, blocks until ctx is done, and then
+// stops them in reverse order.
+func (a *app) run(ctx context.Context) error {
+	if err := a.start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	// Use context.Background() for the stop sequence since ctx is already
+	// cancelled; each hook still gets its own bounded stopTimeout.
+	a.stop(context.Background())
+	return nil
+}
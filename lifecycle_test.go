@@ -0,0 +1,122 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAppStartRunsHooksInOrder(t *testing.T) {
+	a := newApp()
+	var started []string
+	for _, name := range []string{"one", "two", "three"} {
+		name := name
+		a.register(&hook{
+			name: name,
+			onStart: func(ctx context.Context) error {
+				started = append(started, name)
+				return nil
+			},
+		})
+	}
+
+	if err := a.start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"one", "two", "three"}
+	if !equalStrings(started, want) {
+		t.Fatalf("started %v, want %v", started, want)
+	}
+}
+
+func TestAppStartRollsBackOnFailureInReverseOrder(t *testing.T) {
+	a := newApp()
+	var stopped []string
+
+	a.register(&hook{
+		name: "one",
+		onStart: func(ctx context.Context) error {
+			return nil
+		},
+		onStop: func(ctx context.Context) error {
+			stopped = append(stopped, "one")
+			return nil
+		},
+	})
+	a.register(&hook{
+		name: "two",
+		onStart: func(ctx context.Context) error {
+			return nil
+		},
+		onStop: func(ctx context.Context) error {
+			stopped = append(stopped, "two")
+			return nil
+		},
+	})
+	a.register(&hook{
+		name: "three",
+		onStart: func(ctx context.Context) error {
+			return fmt.Errorf("boom")
+		},
+	})
+
+	err := a.start(context.Background())
+	if err == nil {
+		t.Fatal("expected an error from start")
+	}
+
+	want := []string{"two", "one"}
+	if !equalStrings(stopped, want) {
+		t.Fatalf("stopped %v, want %v (reverse of started order, three never started)", stopped, want)
+	}
+	if len(a.started) != 0 {
+		t.Fatalf("a.started = %v, want empty after rollback", a.started)
+	}
+}
+
+func TestAppStopRunsInReverseOrder(t *testing.T) {
+	a := newApp()
+	var stopped []string
+	for _, name := range []string{"one", "two", "three"} {
+		name := name
+		a.register(&hook{
+			name: name,
+			onStart: func(ctx context.Context) error {
+				return nil
+			},
+			onStop: func(ctx context.Context) error {
+				stopped = append(stopped, name)
+				return nil
+			},
+		})
+	}
+
+	if err := a.start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.stop(context.Background())
+
+	want := []string{"three", "two", "one"}
+	if !equalStrings(stopped, want) {
+		t.Fatalf("stopped %v, want %v", stopped, want)
+	}
+	if len(a.started) != 0 {
+		t.Fatalf("a.started = %v, want empty after stop", a.started)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
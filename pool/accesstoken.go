@@ -0,0 +1,110 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// AccessTokenType identifies what an access token is allowed to do.
+type AccessTokenType string
+
+const (
+	// AccessTokenAdmin is the higher privilege level: an admin token
+	// satisfies both admin and readonly checks. It is only checked by
+	// routes wrapped with the gui package's token middleware and does not
+	// stand in for an AdminPass session.
+	AccessTokenAdmin AccessTokenType = "admin"
+
+	// AccessTokenReadOnly grants access to JSON read endpoints only.
+	AccessTokenReadOnly AccessTokenType = "readonly"
+)
+
+// AccessToken is a single named, revocable credential.
+type AccessToken struct {
+	Token string          `json:"token"`
+	Type  AccessTokenType `json:"type"`
+	Name  string          `json:"name"`
+}
+
+// AccessTokenStore persists access tokens in the pool database and answers
+// authorization checks for the gui package's bearer-token middleware.
+type AccessTokenStore struct {
+	db Database
+}
+
+// NewAccessTokenStore creates a store backed by db.
+func NewAccessTokenStore(db Database) *AccessTokenStore {
+	return &AccessTokenStore{db: db}
+}
+
+// Create generates a new random token of the given type, persists it under
+// name, and returns it. name must be unique.
+func (s *AccessTokenStore) Create(tokenType AccessTokenType, name string) (*AccessToken, error) {
+	if tokenType != AccessTokenAdmin && tokenType != AccessTokenReadOnly {
+		return nil, fmt.Errorf("unknown access token type %q", tokenType)
+	}
+
+	existing, err := s.db.fetchAccessTokens()
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range existing {
+		if tok.Name == name {
+			return nil, fmt.Errorf("an access token named %q already exists", name)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("unable to generate access token: %v", err)
+	}
+
+	tok := &AccessToken{
+		Token: hex.EncodeToString(buf),
+		Type:  tokenType,
+		Name:  name,
+	}
+
+	if err := s.db.persistAccessToken(tok); err != nil {
+		return nil, err
+	}
+
+	return tok, nil
+}
+
+// List returns every stored access token.
+func (s *AccessTokenStore) List() ([]*AccessToken, error) {
+	return s.db.fetchAccessTokens()
+}
+
+// Check reports whether token is valid and grants at least the requested
+// type. An admin token satisfies a readonly check.
+func (s *AccessTokenStore) Check(token string, tokenType AccessTokenType) (bool, error) {
+	tokens, err := s.db.fetchAccessTokens()
+	if err != nil {
+		return false, err
+	}
+
+	for _, tok := range tokens {
+		if subtle.ConstantTimeCompare([]byte(tok.Token), []byte(token)) != 1 {
+			continue
+		}
+		if tok.Type == AccessTokenAdmin {
+			return true, nil
+		}
+		return tok.Type == tokenType, nil
+	}
+
+	return false, nil
+}
+
+// Delete removes the named access token.
+func (s *AccessTokenStore) Delete(name string) error {
+	return s.db.deleteAccessToken(name)
+}
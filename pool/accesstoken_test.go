@@ -0,0 +1,111 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeTokenDB is a minimal Database implementation backing AccessTokenStore
+// with an in-memory slice, so its tests don't need a real Bolt or Postgres
+// instance.
+type fakeTokenDB struct {
+	tokens []*AccessToken
+}
+
+func (db *fakeTokenDB) Close() error { return nil }
+
+func (db *fakeTokenDB) Backup(destination string) error { return nil }
+
+func (db *fakeTokenDB) fetchAccessTokens() ([]*AccessToken, error) {
+	return db.tokens, nil
+}
+
+func (db *fakeTokenDB) persistAccessToken(tok *AccessToken) error {
+	db.tokens = append(db.tokens, tok)
+	return nil
+}
+
+func (db *fakeTokenDB) deleteAccessToken(name string) error {
+	for i, tok := range db.tokens {
+		if tok.Name == name {
+			db.tokens = append(db.tokens[:i], db.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no access token named %q", name)
+}
+
+func TestAccessTokenStoreCreateUniqueName(t *testing.T) {
+	store := NewAccessTokenStore(&fakeTokenDB{})
+
+	if _, err := store.Create(AccessTokenReadOnly, "grafana"); err != nil {
+		t.Fatalf("unexpected error creating token: %v", err)
+	}
+	if _, err := store.Create(AccessTokenAdmin, "grafana"); err == nil {
+		t.Fatal("expected an error creating a second token with the same name")
+	}
+}
+
+func TestAccessTokenStoreCheck(t *testing.T) {
+	db := &fakeTokenDB{}
+	store := NewAccessTokenStore(db)
+
+	admin, err := store.Create(AccessTokenAdmin, "admin-dashboard")
+	if err != nil {
+		t.Fatalf("unexpected error creating admin token: %v", err)
+	}
+	readonly, err := store.Create(AccessTokenReadOnly, "grafana")
+	if err != nil {
+		t.Fatalf("unexpected error creating readonly token: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType AccessTokenType
+		want      bool
+	}{
+		{"admin token satisfies admin check", admin.Token, AccessTokenAdmin, true},
+		{"admin token satisfies readonly check", admin.Token, AccessTokenReadOnly, true},
+		{"readonly token satisfies readonly check", readonly.Token, AccessTokenReadOnly, true},
+		{"readonly token fails admin check", readonly.Token, AccessTokenAdmin, false},
+		{"unknown token is rejected", "not-a-real-token", AccessTokenReadOnly, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := store.Check(tc.token, tc.tokenType)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("Check(%q, %s) = %v, want %v", tc.token, tc.tokenType, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccessTokenStoreDelete(t *testing.T) {
+	db := &fakeTokenDB{}
+	store := NewAccessTokenStore(db)
+
+	tok, err := store.Create(AccessTokenAdmin, "admin-dashboard")
+	if err != nil {
+		t.Fatalf("unexpected error creating token: %v", err)
+	}
+
+	if err := store.Delete(tok.Name); err != nil {
+		t.Fatalf("unexpected error deleting token: %v", err)
+	}
+	ok, err := store.Check(tok.Token, AccessTokenAdmin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatal("deleted token should no longer be valid")
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+// Database is the storage contract the pool and its access-token store rely
+// on. Concrete Bolt- and Postgres-backed implementations are returned by
+// InitBoltDB and InitPostgresDB respectively.
+type Database interface {
+	// Close releases the underlying storage handle.
+	Close() error
+
+	// Backup writes a copy of the database to destination. Only the
+	// BoltDB-backed implementation supports this; Postgres is backed up
+	// out-of-band with standard Postgres tooling.
+	Backup(destination string) error
+
+	fetchAccessTokens() ([]*AccessToken, error)
+	persistAccessToken(tok *AccessToken) error
+	deleteAccessToken(name string) error
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+// EventType identifies the kind of activity an EventBus publishes.
+type EventType string
+
+const (
+	// EventBlockFound fires when the pool mines a block.
+	EventBlockFound EventType = "block_found"
+
+	// EventShareAccepted fires when a client's share is accepted.
+	EventShareAccepted EventType = "share_accepted"
+
+	// EventClientConnected fires when a client connects.
+	EventClientConnected EventType = "client_connected"
+
+	// EventClientDisconnected fires when a client disconnects.
+	EventClientDisconnected EventType = "client_disconnected"
+
+	// EventPaymentPaid fires when a payment is marked as paid.
+	EventPaymentPaid EventType = "payment_paid"
+
+	// EventHashrateTick fires on each periodic hashrate update.
+	EventHashrateTick EventType = "hashrate_tick"
+)
+
+// Event is a single notification published on the EventBus.
+type Event struct {
+	Type EventType
+	Data interface{}
+}
+
+// Subscriber receives events published on an EventBus.
+type Subscriber interface {
+	Notify(Event)
+}
+
+// EventBus fans out pool activity (mined blocks, accepted shares, client
+// connects, paid payments, hashrate ticks) to any interested subscriber,
+// such as the GUI's websocket notification manager.
+type EventBus struct {
+	subscribers []Subscriber
+}
+
+// NewEventBus creates an empty EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers a subscriber to receive all published events.
+func (bus *EventBus) Subscribe(sub Subscriber) {
+	bus.subscribers = append(bus.subscribers, sub)
+}
+
+// Publish fans the event out to every subscriber.
+func (bus *EventBus) Publish(evt Event) {
+	for _, sub := range bus.subscribers {
+		sub.Notify(evt)
+	}
+}
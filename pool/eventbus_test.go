@@ -0,0 +1,69 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import "testing"
+
+// recordingSubscriber collects every Event it is notified of, in order.
+type recordingSubscriber struct {
+	events []Event
+}
+
+func (s *recordingSubscriber) Notify(evt Event) {
+	s.events = append(s.events, evt)
+}
+
+func TestEventBusPublishFansOutToAllSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	sub1 := &recordingSubscriber{}
+	sub2 := &recordingSubscriber{}
+	bus.Subscribe(sub1)
+	bus.Subscribe(sub2)
+
+	evt := Event{Type: EventBlockFound, Data: "header"}
+	bus.Publish(evt)
+
+	for i, sub := range []*recordingSubscriber{sub1, sub2} {
+		if len(sub.events) != 1 {
+			t.Fatalf("subscriber %d received %d events, want 1", i, len(sub.events))
+		}
+		if sub.events[0] != evt {
+			t.Fatalf("subscriber %d got %+v, want %+v", i, sub.events[0], evt)
+		}
+	}
+}
+
+func TestEventBusPublishPreservesOrder(t *testing.T) {
+	bus := NewEventBus()
+	sub := &recordingSubscriber{}
+	bus.Subscribe(sub)
+
+	want := []EventType{
+		EventBlockFound,
+		EventShareAccepted,
+		EventClientConnected,
+		EventClientDisconnected,
+		EventPaymentPaid,
+		EventHashrateTick,
+	}
+	for _, typ := range want {
+		bus.Publish(Event{Type: typ})
+	}
+
+	if len(sub.events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(sub.events), len(want))
+	}
+	for i, typ := range want {
+		if sub.events[i].Type != typ {
+			t.Fatalf("event %d has type %s, want %s", i, sub.events[i].Type, typ)
+		}
+	}
+}
+
+func TestEventBusPublishWithNoSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	// Must not panic when nothing is subscribed.
+	bus.Publish(Event{Type: EventBlockFound})
+}
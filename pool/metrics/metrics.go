@@ -0,0 +1,160 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package metrics implements the Prometheus collectors dcrpool exposes for
+// share accounting, hashrate, connected clients and payment activity.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics is the interface the pool and payment manager use to record
+// activity without importing Prometheus directly.
+type Metrics interface {
+	ShareAccepted(miner, client string)
+	ShareRejected(miner, client string)
+	SetClientHashrate(client string, hashesPerSecond float64)
+	SetPoolHashrate(hashesPerSecond float64)
+	SetConnectedClients(host string, count float64)
+	SetLastWorkHeight(height float64)
+	RecordBlockFound()
+	SetPendingPayments(total float64)
+	SetArchivedPayments(total float64)
+	ObserveDBBackupDuration(seconds float64)
+}
+
+// collectors is the Prometheus-backed implementation of Metrics.
+type collectors struct {
+	sharesAccepted   *prometheus.CounterVec
+	sharesRejected   *prometheus.CounterVec
+	clientHashrate   *prometheus.GaugeVec
+	poolHashrate     prometheus.Gauge
+	connectedClients *prometheus.GaugeVec
+	lastWorkHeight   prometheus.Gauge
+	lastBlockFound   prometheus.Gauge
+	pendingPayments  prometheus.Gauge
+	archivedPayments prometheus.Gauge
+	dbBackupDuration prometheus.Histogram
+}
+
+// New creates the collector set and registers it with the default
+// Prometheus registry.
+func New() Metrics {
+	c := &collectors{
+		sharesAccepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dcrpool",
+			Name:      "shares_accepted_total",
+			Help:      "Total number of accepted shares by miner type and client.",
+		}, []string{"miner", "client"}),
+		sharesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dcrpool",
+			Name:      "shares_rejected_total",
+			Help:      "Total number of rejected shares by miner type and client.",
+		}, []string{"miner", "client"}),
+		clientHashrate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "client_hashrate_hashes_per_second",
+			Help:      "Estimated hashrate of a connected client.",
+		}, []string{"client"}),
+		poolHashrate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "pool_hashrate_hashes_per_second",
+			Help:      "Estimated aggregate hashrate of the pool.",
+		}),
+		connectedClients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "connected_clients",
+			Help:      "Number of clients currently connected by host.",
+		}, []string{"host"}),
+		lastWorkHeight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "last_work_height",
+			Help:      "Block height of the most recently distributed work.",
+		}),
+		lastBlockFound: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "last_block_found_timestamp_seconds",
+			Help:      "Unix timestamp at which the pool last found a block.",
+		}),
+		pendingPayments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "pending_payments_total",
+			Help:      "Total value of pending payments.",
+		}),
+		archivedPayments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "dcrpool",
+			Name:      "archived_payments_total",
+			Help:      "Total value of archived (paid) payments.",
+		}),
+		dbBackupDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "dcrpool",
+			Name:      "db_backup_duration_seconds",
+			Help:      "Time taken to complete a database backup.",
+		}),
+	}
+
+	prometheus.MustRegister(
+		c.sharesAccepted,
+		c.sharesRejected,
+		c.clientHashrate,
+		c.poolHashrate,
+		c.connectedClients,
+		c.lastWorkHeight,
+		c.lastBlockFound,
+		c.pendingPayments,
+		c.archivedPayments,
+		c.dbBackupDuration,
+	)
+
+	return c
+}
+
+func (c *collectors) ShareAccepted(miner, client string) {
+	c.sharesAccepted.WithLabelValues(miner, client).Inc()
+}
+
+func (c *collectors) ShareRejected(miner, client string) {
+	c.sharesRejected.WithLabelValues(miner, client).Inc()
+}
+
+func (c *collectors) SetClientHashrate(client string, hashesPerSecond float64) {
+	c.clientHashrate.WithLabelValues(client).Set(hashesPerSecond)
+}
+
+func (c *collectors) SetPoolHashrate(hashesPerSecond float64) {
+	c.poolHashrate.Set(hashesPerSecond)
+}
+
+func (c *collectors) SetConnectedClients(host string, count float64) {
+	c.connectedClients.WithLabelValues(host).Set(count)
+}
+
+func (c *collectors) SetLastWorkHeight(height float64) {
+	c.lastWorkHeight.Set(height)
+}
+
+func (c *collectors) RecordBlockFound() {
+	c.lastBlockFound.SetToCurrentTime()
+}
+
+func (c *collectors) SetPendingPayments(total float64) {
+	c.pendingPayments.Set(total)
+}
+
+func (c *collectors) SetArchivedPayments(total float64) {
+	c.archivedPayments.Set(total)
+}
+
+func (c *collectors) ObserveDBBackupDuration(seconds float64) {
+	c.dbBackupDuration.Observe(seconds)
+}
+
+// Handler returns the HTTP handler that serves the /metrics endpoint.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import "testing"
+
+// TestNewRegistersAllCollectors exercises every Metrics method once. New
+// registers its collectors with the default Prometheus registry, so calling
+// it more than once per process panics on a duplicate registration; this
+// test therefore calls New once and exercises every method on that single
+// collector set.
+func TestNewRegistersAllCollectors(t *testing.T) {
+	m := New()
+
+	// None of these should panic; Prometheus collectors accept any label
+	// values and numeric inputs without validation of their own.
+	m.ShareAccepted("cpuminer", "client1")
+	m.ShareRejected("cpuminer", "client1")
+	m.SetClientHashrate("client1", 123.4)
+	m.SetPoolHashrate(5678.9)
+	m.SetConnectedClients("10.0.0.1", 3)
+	m.SetLastWorkHeight(654321)
+	m.RecordBlockFound()
+	m.SetPendingPayments(1.5)
+	m.SetArchivedPayments(42)
+	m.ObserveDBBackupDuration(0.25)
+}
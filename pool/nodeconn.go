@@ -0,0 +1,214 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/rpcclient/v6"
+)
+
+const (
+	// maxReconnectBackoff is the upper bound on the exponential backoff
+	// applied between failover attempts.
+	maxReconnectBackoff = time.Minute
+
+	// healthCheckInterval is how often the active node connection is
+	// polled for liveness.
+	healthCheckInterval = time.Second * 30
+
+	// maxHealthCheckFailures is the number of consecutive health check
+	// failures tolerated before the active node is demoted.
+	maxHealthCheckFailures = 3
+)
+
+// RPCClient is the subset of *rpcclient.Client that NodeConnManager and its
+// callers depend on. Declaring it as an interface, rather than passing
+// *rpcclient.Client around directly, lets tests substitute a fake client and
+// exercise dialNext's failover/promotion ordering without dialing a real
+// dcrd instance.
+type RPCClient interface {
+	NotifyWork(ctx context.Context) error
+	NotifyBlocks(ctx context.Context) error
+	GetBlockCount(ctx context.Context) (int64, error)
+	Shutdown()
+}
+
+// NodeConnManager maintains connections to a set of dcrd RPC endpoints,
+// keeps one of them active at a time and transparently fails over to the
+// next healthy peer when the active connection is lost. It is the backing
+// implementation behind Hub.nodeConn, so callers never observe the swap.
+type NodeConnManager struct {
+	cfgs     []*rpcclient.ConnConfig
+	handlers *rpcclient.NotificationHandlers
+
+	// dial constructs the client for a single endpoint. It is rpcclient.New
+	// in production; tests substitute a fake so dialNext's ordering can be
+	// exercised without a live dcrd connection.
+	dial func(*rpcclient.ConnConfig, *rpcclient.NotificationHandlers) (RPCClient, error)
+
+	mtx       sync.RWMutex
+	active    RPCClient
+	activeIdx int
+
+	resubscribe func(RPCClient) error
+
+	// runCtx/cancel are created once at construction time so Shutdown can
+	// always call cancel, whether or not Run has started yet.
+	runCtx context.Context
+	cancel context.CancelFunc
+}
+
+// NewNodeConnManager dials the first reachable endpoint in cfgs and returns
+// a manager that keeps it connected, failing over to the remaining entries
+// as needed. resubscribe is invoked with every newly dialed client,
+// including the first, so the caller can re-issue NotifyWork/NotifyBlocks;
+// a client is only promoted once resubscribe succeeds.
+func NewNodeConnManager(cfgs []*rpcclient.ConnConfig, handlers *rpcclient.NotificationHandlers, resubscribe func(RPCClient) error) (*NodeConnManager, error) {
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("no dcrd rpc endpoints provided")
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	mgr := &NodeConnManager{
+		cfgs:     cfgs,
+		handlers: handlers,
+		dial: func(cfg *rpcclient.ConnConfig, handlers *rpcclient.NotificationHandlers) (RPCClient, error) {
+			return rpcclient.New(cfg, handlers)
+		},
+		resubscribe: resubscribe,
+		activeIdx:   -1,
+		runCtx:      runCtx,
+		cancel:      cancel,
+	}
+
+	if err := mgr.dialNext(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// dialNext attempts to dial each configured endpoint in turn, starting
+// after the current active index, and promotes the first one that
+// succeeds. A client is only promoted to active once resubscribe has
+// confirmed it, so Active never returns a connection whose notification
+// subscriptions failed to re-establish.
+func (mgr *NodeConnManager) dialNext() error {
+	mgr.mtx.Lock()
+	start := mgr.activeIdx
+	mgr.mtx.Unlock()
+
+	var lastErr error
+	for i := 1; i <= len(mgr.cfgs); i++ {
+		idx := (start + i) % len(mgr.cfgs)
+		client, err := mgr.dial(mgr.cfgs[idx], mgr.handlers)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if mgr.resubscribe != nil {
+			if err := mgr.resubscribe(client); err != nil {
+				client.Shutdown()
+				lastErr = err
+				continue
+			}
+		}
+
+		mgr.mtx.Lock()
+		mgr.active = client
+		mgr.activeIdx = idx
+		mgr.mtx.Unlock()
+
+		return nil
+	}
+
+	return fmt.Errorf("unable to dial any dcrd rpc endpoint: %v", lastErr)
+}
+
+// Active returns the currently promoted RPC client. Callers should not
+// cache the returned client across failovers; fetch it again before each
+// use.
+func (mgr *NodeConnManager) Active() RPCClient {
+	mgr.mtx.RLock()
+	defer mgr.mtx.RUnlock()
+	return mgr.active
+}
+
+// failover demotes the active connection and promotes the next healthy
+// peer, retrying with exponential backoff until one succeeds or the
+// manager is shut down.
+func (mgr *NodeConnManager) failover(ctx context.Context) {
+	backoff := time.Second
+	for {
+		if err := mgr.dialNext(); err == nil {
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Run starts the health-check loop that periodically probes the active
+// node and triggers a failover after repeated failures. It blocks until
+// ctx or the manager's own Shutdown is triggered.
+func (mgr *NodeConnManager) Run(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			mgr.cancel()
+		case <-mgr.runCtx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	var failures int
+	for {
+		select {
+		case <-mgr.runCtx.Done():
+			return
+
+		case <-ticker.C:
+			client := mgr.Active()
+			if client == nil {
+				continue
+			}
+			if _, err := client.GetBlockCount(mgr.runCtx); err != nil {
+				failures++
+				if failures >= maxHealthCheckFailures {
+					failures = 0
+					client.Shutdown()
+					mgr.failover(mgr.runCtx)
+				}
+				continue
+			}
+			failures = 0
+		}
+	}
+}
+
+// Shutdown stops the health-check loop and closes the active connection.
+// It is always safe to call, whether or not Run has started.
+func (mgr *NodeConnManager) Shutdown() {
+	mgr.cancel()
+	if client := mgr.Active(); client != nil {
+		client.Shutdown()
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/decred/dcrd/rpcclient/v6"
+)
+
+// fakeRPCClient is a minimal RPCClient used to drive dialNext without
+// dialing a real dcrd instance.
+type fakeRPCClient struct {
+	idx       int
+	shutdown  bool
+	notifyErr error
+}
+
+func (c *fakeRPCClient) NotifyWork(ctx context.Context) error   { return c.notifyErr }
+func (c *fakeRPCClient) NotifyBlocks(ctx context.Context) error { return c.notifyErr }
+func (c *fakeRPCClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+func (c *fakeRPCClient) Shutdown() { c.shutdown = true }
+
+// newTestManager builds a NodeConnManager bypassing NewNodeConnManager (and
+// so its immediate dialNext call), wiring in dial so tests can control which
+// configured index succeeds without a live dcrd connection. cfgs only need
+// to be distinct pointers; none of their fields are read.
+func newTestManager(n int, dial func(idx int) (RPCClient, error)) *NodeConnManager {
+	cfgs := make([]*rpcclient.ConnConfig, n)
+	for i := range cfgs {
+		cfgs[i] = &rpcclient.ConnConfig{}
+	}
+
+	// The dial wrapper below looks up the config by pointer identity to
+	// recover which index mgr.dial was called for, since
+	// *rpcclient.ConnConfig carries no other identifying field in this fake
+	// setup.
+	idxByCfg := make(map[*rpcclient.ConnConfig]int, n)
+	for i, cfg := range cfgs {
+		idxByCfg[cfg] = i
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	return &NodeConnManager{
+		cfgs: cfgs,
+		dial: func(cfg *rpcclient.ConnConfig, _ *rpcclient.NotificationHandlers) (RPCClient, error) {
+			return dial(idxByCfg[cfg])
+		},
+		activeIdx: -1,
+		runCtx:    runCtx,
+		cancel:    cancel,
+	}
+}
+
+func TestDialNextSkipsUnreachableEndpoints(t *testing.T) {
+	// Endpoints 0 and 1 fail to dial; only 2 succeeds. Starting from
+	// activeIdx -1, dialNext must try 0, then 1, then 2, moving on after
+	// each failure rather than stopping after the first one.
+	var tried []int
+	client := &fakeRPCClient{idx: 2}
+	mgr := newTestManager(3, func(idx int) (RPCClient, error) {
+		tried = append(tried, idx)
+		if idx != 2 {
+			return nil, fmt.Errorf("endpoint %d unreachable", idx)
+		}
+		return client, nil
+	})
+
+	if err := mgr.dialNext(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{0, 1, 2}; !equalInts(tried, want) {
+		t.Fatalf("tried endpoints %v, want %v", tried, want)
+	}
+	if mgr.activeIdx != 2 {
+		t.Fatalf("activeIdx = %d, want 2", mgr.activeIdx)
+	}
+	if mgr.Active() != client {
+		t.Fatal("Active() did not return the dialed client")
+	}
+}
+
+func TestDialNextStartsAfterCurrentActive(t *testing.T) {
+	// With activeIdx already at 1, dialNext should try 2, then wrap to 0,
+	// skipping 1 (the one that just failed) until it finds a fresh index.
+	var tried []int
+	client := &fakeRPCClient{}
+	mgr := newTestManager(3, func(idx int) (RPCClient, error) {
+		tried = append(tried, idx)
+		if idx != 0 {
+			return nil, fmt.Errorf("endpoint %d unreachable", idx)
+		}
+		return client, nil
+	})
+	mgr.activeIdx = 1
+
+	if err := mgr.dialNext(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{2, 0}; !equalInts(tried, want) {
+		t.Fatalf("tried endpoints %v, want %v", tried, want)
+	}
+	if mgr.activeIdx != 0 {
+		t.Fatalf("activeIdx = %d, want 0", mgr.activeIdx)
+	}
+}
+
+func TestDialNextOnlyPromotesAfterResubscribeSucceeds(t *testing.T) {
+	// Endpoint 0 dials fine but fails to resubscribe; dialNext must move on
+	// to endpoint 1 rather than leaving the unresubscribed client active.
+	bad := &fakeRPCClient{}
+	good := &fakeRPCClient{}
+	mgr := newTestManager(2, func(idx int) (RPCClient, error) {
+		if idx == 0 {
+			return bad, nil
+		}
+		return good, nil
+	})
+	mgr.resubscribe = func(client RPCClient) error {
+		if client == bad {
+			return fmt.Errorf("resubscribe failed")
+		}
+		return nil
+	}
+
+	if err := mgr.dialNext(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mgr.Active() != good {
+		t.Fatal("Active() promoted a client that never resubscribed")
+	}
+	if !bad.shutdown {
+		t.Fatal("the rejected client was not shut down")
+	}
+}
+
+func TestDialNextAllEndpointsFail(t *testing.T) {
+	mgr := newTestManager(2, func(idx int) (RPCClient, error) {
+		return nil, fmt.Errorf("endpoint %d unreachable", idx)
+	})
+
+	if err := mgr.dialNext(); err == nil {
+		t.Fatal("expected an error when every endpoint fails to dial")
+	}
+	if mgr.Active() != nil {
+		t.Fatal("Active() should remain nil when no endpoint could be promoted")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
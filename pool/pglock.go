@@ -0,0 +1,71 @@
+// Copyright (c) 2019 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// pgAdvisoryLockKey is an arbitrary, well-known key used to coordinate a
+// single active dcrpool instance across hosts sharing one Postgres
+// database. It has no special meaning beyond being unique to dcrpool.
+const pgAdvisoryLockKey = 0x64637270 // "dcrp"
+
+// PGAdvisoryLock holds a session-scoped pg_try_advisory_lock for the life
+// of the process. A session-scoped advisory lock is bound to the
+// connection that took it, so it must be held on a dedicated *sql.Conn
+// rather than a *sql.DB pool: database/sql is free to close or hand that
+// pooled connection to an unrelated query, which would silently release
+// the lock while dcrpool keeps running.
+type PGAdvisoryLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+// AcquirePGAdvisoryLock opens a dedicated connection to the Postgres
+// database described by dsn and takes a pg_try_advisory_lock on it, so
+// that two dcrpool instances pointed at the same database, even on
+// different hosts, cannot both proceed.
+func AcquirePGAdvisoryLock(ctx context.Context, dsn string) (*PGAdvisoryLock, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open postgres connection: %v", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to acquire a dedicated postgres connection: %v", err)
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", pgAdvisoryLockKey).
+		Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("unable to acquire postgres advisory lock: %v", err)
+	}
+	if !acquired {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("another dcrpool instance appears to be running " +
+			"against this postgres database")
+	}
+
+	return &PGAdvisoryLock{db: db, conn: conn}, nil
+}
+
+// Release unlocks the advisory lock and closes the dedicated connection.
+func (l *PGAdvisoryLock) Release(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", pgAdvisoryLockKey)
+	l.conn.Close()
+	l.db.Close()
+	return err
+}